@@ -0,0 +1,11 @@
+//go:build amd64
+
+package main
+
+import "katalvlaran/ip_counter/internal/cpu"
+
+func init() {
+	if cpu.HasSSE42 {
+		parseIPv4 = ipToIntVectorized
+	}
+}
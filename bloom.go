@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// DefaultBloomBits sizes the filter for roughly a ~1% false-positive rate
+	// at a few hundred million distinct IPv4 addresses.
+	DefaultBloomBits = 1 << 31
+	// BloomHashCount is k, the number of probe bits set/checked per IP.
+	BloomHashCount = 7
+
+	// fnvOffset64 and fnvPrime64 are the FNV-1/1a 64-bit constants, inlined
+	// below instead of going through hash/fnv so probeHashes allocates nothing.
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// BloomPrefilter is a lock-free probabilistic set placed in front of
+// SegmentedBitmap. Real logs repeat the same handful of IPs millions of
+// times, and every repeat otherwise takes the segment mutex in MarkIP just
+// to discover the bit is already set. A "maybe-seen" result here lets
+// processBatch skip that mutex entirely; sb.MarkIP remains the authority,
+// since the filter can false-positive but never false-negative.
+type BloomPrefilter struct {
+	bits []uint64 // Bit array, 64 bits per word; probed and set with atomic ops.
+	size uint64   // Total number of bits (len(bits) * 64).
+}
+
+// NewBloomPrefilter allocates a bloom filter with numBits bits, rounded up
+// to a whole number of 64-bit words. A numBits of 0 uses DefaultBloomBits.
+func NewBloomPrefilter(numBits uint64) *BloomPrefilter {
+	if numBits == 0 {
+		numBits = DefaultBloomBits
+	}
+	words := (numBits + 63) / 64
+	return &BloomPrefilter{bits: make([]uint64, words), size: words * 64}
+}
+
+// probeHashes returns the two independent 64-bit hashes that double hashing
+// (h1 + i*h2) combines into the k probe positions, avoiding k independent
+// hash functions. Both are computed inline via FNV-1a/FNV-1 arithmetic on
+// ipInt's 4 bytes rather than going through hash/fnv, since this runs on
+// every line, including the millions of repeats the filter exists to skip,
+// and boxing two hash.Hash64 values per call would trade the mutex it
+// replaces for heap allocations on the exact same hot path.
+func probeHashes(ipInt uint32) (uint64, uint64) {
+	buf := [4]byte{byte(ipInt >> 24), byte(ipInt >> 16), byte(ipInt >> 8), byte(ipInt)}
+
+	h1 := uint64(fnvOffset64)
+	h2 := uint64(fnvOffset64)
+	for _, b := range buf {
+		h1 ^= uint64(b) // FNV-1a: XOR then multiply.
+		h1 *= fnvPrime64
+		h2 *= fnvPrime64 // FNV-1: multiply then XOR.
+		h2 ^= uint64(b)
+	}
+	return h1, h2
+}
+
+// MaybeSeen reports whether every one of ipInt's k probe bits is already
+// set. A false result is certain; a true result is only probable (~1% FPR
+// at the default size) and must still be confirmed against SegmentedBitmap.
+func (bf *BloomPrefilter) MaybeSeen(ipInt uint32) bool {
+	h1, h2 := probeHashes(ipInt)
+	for i := uint64(0); i < BloomHashCount; i++ {
+		pos := (h1 + i*h2) % bf.size
+		word, bit := pos/64, pos%64
+		if atomic.LoadUint64(&bf.bits[word])&(1<<bit) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add sets ipInt's k probe bits using a lock-free atomic OR, so concurrent
+// workers never contend on a mutex to record a probable-new IP.
+func (bf *BloomPrefilter) Add(ipInt uint32) {
+	h1, h2 := probeHashes(ipInt)
+	for i := uint64(0); i < BloomHashCount; i++ {
+		pos := (h1 + i*h2) % bf.size
+		word, bit := pos/64, pos%64
+		orUint64(&bf.bits[word], 1<<bit)
+	}
+}
+
+// orUint64 atomically ORs mask into *addr via a compare-and-swap retry loop,
+// since there is no AtomicOr for uint64 on older Go versions.
+func orUint64(addr *uint64, mask uint64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		next := old | mask
+		if next == old || atomic.CompareAndSwapUint64(addr, old, next) {
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+const (
+	SnapshotVersion    = 1         // Bumped whenever the on-disk segment layout changes.
+	snapshotHeaderSize = 4 + 4 + 4 // version + segment index + CRC32C, each a uint32.
+)
+
+// crc32cTable is the Castagnoli polynomial table used to checksum each
+// segment snapshot, matching what crc32.Checksum expects.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SaveSnapshot writes each bitmap segment to its own seg-%03d.bin file under
+// dir, so a crash or OOM on a multi-hour run doesn't lose all progress.
+// Segments are independent files with their own lock, so snapshotting one
+// segment never blocks workers touching another.
+func (sb *SegmentedBitmap) SaveSnapshot(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	for i := range sb.segments {
+		if err := sb.saveSegment(dir, i); err != nil {
+			return fmt.Errorf("failed to save segment %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// saveSegment writes one segment's header and data, via a temp file plus
+// rename, so a crash mid-write never leaves a corrupt snapshot in place.
+func (sb *SegmentedBitmap) saveSegment(dir string, index int) error {
+	sb.mutexes[index].Lock()
+	defer sb.mutexes[index].Unlock()
+
+	data := sb.segments[index]
+	var header [snapshotHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], SnapshotVersion)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(index))
+	binary.LittleEndian.PutUint32(header[8:12], crc32.Checksum(data, crc32cTable))
+
+	path := filepath.Join(dir, fmt.Sprintf("seg-%03d.bin", index))
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadSnapshot rehydrates the bitmap from segment files previously written
+// by SaveSnapshot. A missing segment file is left zeroed rather than
+// treated as an error, since a snapshot can be taken mid-run.
+func (sb *SegmentedBitmap) LoadSnapshot(dir string) error {
+	for i := range sb.segments {
+		if err := sb.loadSegment(dir, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sb *SegmentedBitmap) loadSegment(dir string, index int) error {
+	path := filepath.Join(dir, fmt.Sprintf("seg-%03d.bin", index))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // No snapshot for this segment yet: keep it zeroed.
+		}
+		return fmt.Errorf("failed to read segment %d: %w", index, err)
+	}
+	if len(data) != snapshotHeaderSize+BytesPerSegment {
+		return fmt.Errorf("segment %d: unexpected snapshot size %d", index, len(data))
+	}
+
+	header, body := data[:snapshotHeaderSize], data[snapshotHeaderSize:]
+	if version := binary.LittleEndian.Uint32(header[0:4]); version != SnapshotVersion {
+		return fmt.Errorf("segment %d: unsupported snapshot version %d", index, version)
+	}
+	if segmentIndex := binary.LittleEndian.Uint32(header[4:8]); int(segmentIndex) != index {
+		return fmt.Errorf("segment %d: snapshot header claims segment %d", index, segmentIndex)
+	}
+	wantCRC := binary.LittleEndian.Uint32(header[8:12])
+	if gotCRC := crc32.Checksum(body, crc32cTable); gotCRC != wantCRC {
+		return fmt.Errorf("segment %d: checksum mismatch (want %x, got %x)", index, wantCRC, gotCRC)
+	}
+
+	sb.mutexes[index].Lock()
+	copy(sb.segments[index], body)
+	sb.mutexes[index].Unlock()
+	return nil
+}
@@ -0,0 +1,13 @@
+// Package cpu exposes runtime CPU feature detection so hot paths elsewhere
+// in the program can pick an accelerated implementation when it is safe to
+// do so, and fall back to portable scalar code otherwise.
+package cpu
+
+// Feature flags populated at init time. They default to false on platforms
+// or architectures where detection is not implemented, which keeps callers
+// on the scalar fallback automatically.
+var (
+	HasPOPCNT bool // POPCNT instruction available (hardware bit-counting).
+	HasSSE42  bool // SSE4.2 available (string/text processing instructions).
+	HasAVX2   bool // AVX2 available (256-bit integer vector instructions).
+)
@@ -0,0 +1,18 @@
+//go:build amd64
+
+package cpu
+
+// cpuid is implemented in cpuid_amd64.s and wraps the CPUID instruction for
+// the given leaf/sub-leaf pair.
+//
+//go:noescape
+func cpuid(leaf, subleaf uint32) (eax, ebx, ecx, edx uint32)
+
+func init() {
+	_, _, ecx1, _ := cpuid(1, 0)
+	HasPOPCNT = ecx1&(1<<23) != 0
+	HasSSE42 = ecx1&(1<<20) != 0
+
+	_, ebx7, _, _ := cpuid(7, 0)
+	HasAVX2 = ebx7&(1<<5) != 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// parseIPv4 is the IPv4 parser used on the hot path. It takes ip as a byte
+// slice so it can parse directly out of a mapped file region or reusable
+// read buffer without allocating a string per line. It defaults to the
+// scalar ipToInt and is upgraded to the vectorized implementation at init
+// time on CPUs that report SSE4.2 support (see accel_amd64.go).
+var parseIPv4 = ipToInt
+
+// ipv4LoadSize is the number of bytes loaded at once when scanning for dot
+// delimiters. 16 bytes comfortably covers "255.255.255.255" (15 bytes).
+const ipv4LoadSize = 16
+
+// dotPattern is '.' (0x2e) broadcast across every byte lane of a 64-bit word.
+const dotPattern = 0x2e2e2e2e2e2e2e2e
+
+// laneEqMask returns a byte mask with bit i set when byte lane i of v equals
+// the broadcast dot pattern. This is the classic SWAR (SIMD-within-a-register)
+// "find byte" trick, standing in for the single-instruction delimiter search
+// an SSE4.2 _mm_cmpistri would perform.
+func laneEqMask(v uint64) uint8 {
+	x := v ^ dotPattern
+	diff := (x - 0x0101010101010101) & ^x & 0x8080808080808080
+	var mask uint8
+	for i := uint(0); i < 8; i++ {
+		if diff&(0x80<<(8*i)) != 0 {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// ipToIntVectorized parses an IPv4 literal using a single 16-byte load and a
+// SWAR delimiter scan instead of a byte-by-byte split, then converts each
+// octet the same way ipToInt does. ipToInt remains the fallback for anything
+// that doesn't fit the fixed-size load.
+func ipToIntVectorized(ip []byte) uint32 {
+	if len(ip) == 0 || len(ip) > ipv4LoadSize-1 {
+		return ipToInt(ip)
+	}
+
+	var buf [ipv4LoadSize]byte
+	copy(buf[:], ip)
+	for i := len(ip); i < ipv4LoadSize; i++ {
+		buf[i] = '.' // Pad with the delimiter so the scan stops cleanly.
+	}
+
+	lo := laneEqMask(binary.LittleEndian.Uint64(buf[0:8]))
+	hi := laneEqMask(binary.LittleEndian.Uint64(buf[8:16]))
+	dots := uint16(lo) | uint16(hi)<<8
+
+	var result uint32
+	start := 0
+	for octet := 0; octet < 4; octet++ {
+		end := len(ip)
+		if next := bits.TrailingZeros16(dots >> uint(start)); start+next < len(ip) {
+			end = start + next
+		}
+		var value uint32
+		for _, c := range buf[start:end] {
+			value = value*10 + uint32(c-'0')
+		}
+		result |= value << (BitsInByte * uint(3-octet))
+		start = end + 1
+	}
+	return result
+}
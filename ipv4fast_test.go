@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestIpToIntVectorizedMatchesScalar(t *testing.T) {
+	cases := []string{
+		"0.0.0.0",
+		"255.255.255.255",
+		"192.168.1.1",
+		"10.0.0.1",
+		"1.2.3.4",
+	}
+
+	for _, ip := range cases {
+		want := ipToInt([]byte(ip))
+		got := ipToIntVectorized([]byte(ip))
+		if got != want {
+			t.Errorf("ipToIntVectorized(%q) = %d, want %d (ipToInt)", ip, got, want)
+		}
+	}
+}
+
+func TestIpToIntVectorizedFallsBackOnOversizeInput(t *testing.T) {
+	// Longer than ipv4LoadSize-1 bytes can hold; must still match the scalar parser.
+	ip := []byte("255.255.255.255x")
+	if got, want := ipToIntVectorized(ip), ipToInt(ip); got != want {
+		t.Errorf("ipToIntVectorized(%q) = %d, want %d (ipToInt fallback)", ip, got, want)
+	}
+}
+
+func TestLaneEqMask(t *testing.T) {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = 'x'
+	}
+	buf[3] = '.'
+	buf[6] = '.'
+
+	got := laneEqMask(uint64(buf[0]) | uint64(buf[1])<<8 | uint64(buf[2])<<16 | uint64(buf[3])<<24 |
+		uint64(buf[4])<<32 | uint64(buf[5])<<40 | uint64(buf[6])<<48 | uint64(buf[7])<<56)
+	want := uint8(1<<3 | 1<<6)
+	if got != want {
+		t.Errorf("laneEqMask = %08b, want %08b", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	IPv6Shards        = 256 // Number of shards for the IPv6 prefix set, mirrors BitmapSegments.
+	DefaultIPv6Prefix = 64  // Default CIDR prefix length used to aggregate IPv6 addresses.
+)
+
+// Ipv6PrefixSet tracks unique IPv6 address prefixes using a sharded hash set.
+// A flat 128-bit bitmap is infeasible for IPv6, so addresses are masked down
+// to prefixLen bits (default /64) before being recorded.
+type Ipv6PrefixSet struct {
+	prefixLen int                                // Number of leading bits kept when masking an address.
+	shards    [IPv6Shards]map[[16]byte]struct{}  // Per-shard sets of masked prefixes.
+	mutexes   [IPv6Shards]sync.Mutex             // Mutexes for thread-safe access to shards.
+}
+
+// NewIpv6PrefixSet initializes an Ipv6PrefixSet for the given CIDR prefix length.
+// prefixLen must be in [0, 128]; a negative length, or one of 136 or more,
+// would index past the 16-byte address the first time maskIPv6 runs.
+func NewIpv6PrefixSet(prefixLen int) (*Ipv6PrefixSet, error) {
+	if prefixLen < 0 || prefixLen > 128 {
+		return nil, fmt.Errorf("ipv6 prefix length %d out of range [0, 128]", prefixLen)
+	}
+	ps := &Ipv6PrefixSet{prefixLen: prefixLen}
+	for i := range ps.shards {
+		ps.shards[i] = make(map[[16]byte]struct{})
+	}
+	return ps, nil
+}
+
+// MarkIP masks addr to the configured prefix length and records it.
+// Returns true if the masked prefix was not previously marked, false otherwise.
+func (ps *Ipv6PrefixSet) MarkIP(addr [16]byte) bool {
+	masked := maskIPv6(addr, ps.prefixLen)
+	shardIndex := masked[0] // First byte is evenly distributed for random addresses.
+
+	ps.mutexes[shardIndex].Lock()
+	defer ps.mutexes[shardIndex].Unlock()
+
+	if _, seen := ps.shards[shardIndex][masked]; seen {
+		return false // Prefix was already marked.
+	}
+	ps.shards[shardIndex][masked] = struct{}{}
+	return true
+}
+
+// Cleanup releases the memory allocated for the shard maps to free resources.
+func (ps *Ipv6PrefixSet) Cleanup() {
+	for i := range ps.shards {
+		ps.mutexes[i].Lock()
+		ps.shards[i] = nil
+		ps.mutexes[i].Unlock()
+	}
+}
+
+// maskIPv6 zeroes every bit beyond prefixLen, keeping only the network portion of addr.
+func maskIPv6(addr [16]byte, prefixLen int) [16]byte {
+	var masked [16]byte
+	fullBytes := prefixLen / BitsInByte
+	remainingBits := prefixLen % BitsInByte
+
+	copy(masked[:fullBytes], addr[:fullBytes])
+	if remainingBits > 0 && fullBytes < 16 {
+		mask := byte(0xFF << (BitsInByte - remainingBits))
+		masked[fullBytes] = addr[fullBytes] & mask
+	}
+	return masked
+}
+
+// ipv6SnapshotHeaderSize mirrors checkpoint.go's snapshotHeaderSize: version
+// + shard index + CRC32C, each a uint32.
+const ipv6SnapshotHeaderSize = 4 + 4 + 4
+
+// SaveSnapshot writes each shard's set of masked prefixes to its own
+// ipv6-shard-%03d.bin file under dir, using the same header/CRC32C/
+// temp-file-then-rename layout as SegmentedBitmap.SaveSnapshot. Without this,
+// a resumed run would silently lose every IPv6 prefix seen before the last
+// checkpoint, since the WAL still seeks the reader past that input.
+func (ps *Ipv6PrefixSet) SaveSnapshot(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	for i := range ps.shards {
+		if err := ps.saveShard(dir, i); err != nil {
+			return fmt.Errorf("failed to save ipv6 shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// saveShard writes one shard's header and 16-byte-per-entry prefix data, via
+// a temp file plus rename, so a crash mid-write never leaves a corrupt
+// snapshot in place.
+func (ps *Ipv6PrefixSet) saveShard(dir string, index int) error {
+	ps.mutexes[index].Lock()
+	entries := make([]byte, 0, len(ps.shards[index])*16)
+	for addr := range ps.shards[index] {
+		entries = append(entries, addr[:]...)
+	}
+	ps.mutexes[index].Unlock()
+
+	var header [ipv6SnapshotHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], SnapshotVersion)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(index))
+	binary.LittleEndian.PutUint32(header[8:12], crc32.Checksum(entries, crc32cTable))
+
+	path := filepath.Join(dir, fmt.Sprintf("ipv6-shard-%03d.bin", index))
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := f.Write(entries); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadSnapshot rehydrates the prefix set from shard files previously written
+// by SaveSnapshot. A missing shard file is left empty rather than treated as
+// an error, since a snapshot can be taken mid-run.
+func (ps *Ipv6PrefixSet) LoadSnapshot(dir string) error {
+	for i := range ps.shards {
+		if err := ps.loadShard(dir, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *Ipv6PrefixSet) loadShard(dir string, index int) error {
+	path := filepath.Join(dir, fmt.Sprintf("ipv6-shard-%03d.bin", index))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // No snapshot for this shard yet: keep it empty.
+		}
+		return fmt.Errorf("failed to read ipv6 shard %d: %w", index, err)
+	}
+	if len(data) < ipv6SnapshotHeaderSize {
+		return fmt.Errorf("ipv6 shard %d: truncated snapshot", index)
+	}
+
+	header, entries := data[:ipv6SnapshotHeaderSize], data[ipv6SnapshotHeaderSize:]
+	if version := binary.LittleEndian.Uint32(header[0:4]); version != SnapshotVersion {
+		return fmt.Errorf("ipv6 shard %d: unsupported snapshot version %d", index, version)
+	}
+	if shardIndex := binary.LittleEndian.Uint32(header[4:8]); int(shardIndex) != index {
+		return fmt.Errorf("ipv6 shard %d: snapshot header claims shard %d", index, shardIndex)
+	}
+	wantCRC := binary.LittleEndian.Uint32(header[8:12])
+	if gotCRC := crc32.Checksum(entries, crc32cTable); gotCRC != wantCRC {
+		return fmt.Errorf("ipv6 shard %d: checksum mismatch (want %x, got %x)", index, wantCRC, gotCRC)
+	}
+	if len(entries)%16 != 0 {
+		return fmt.Errorf("ipv6 shard %d: entry data not a multiple of 16 bytes", index)
+	}
+
+	ps.mutexes[index].Lock()
+	for off := 0; off < len(entries); off += 16 {
+		var addr [16]byte
+		copy(addr[:], entries[off:off+16])
+		ps.shards[index][addr] = struct{}{}
+	}
+	ps.mutexes[index].Unlock()
+	return nil
+}
+
+// parseIPv6 converts an IPv6 address to its 16-byte representation. net.ParseIP only
+// accepts a string, so unlike the IPv4 fast path this allocates one string per line;
+// IPv6 lines are rare enough in practice that this is not the hot path.
+// The second return value is false if ip does not parse as an IP address; a dotted
+// IPv4 literal is accepted and returned in its IPv4-mapped form.
+func parseIPv6(ip []byte) ([16]byte, bool) {
+	var addr [16]byte
+	parsed := net.ParseIP(string(ip))
+	if parsed == nil {
+		return addr, false
+	}
+	v6 := parsed.To16()
+	if v6 == nil {
+		return addr, false
+	}
+	copy(addr[:], v6)
+	return addr, true
+}
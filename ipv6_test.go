@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestMaskIPv6(t *testing.T) {
+	addr := [16]byte{0x20, 0x01, 0x0d, 0xb8, 0xab, 0xcd, 0xef, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	cases := []struct {
+		name      string
+		prefixLen int
+		want      [16]byte
+	}{
+		{
+			name:      "byte-aligned /64",
+			prefixLen: 64,
+			want:      [16]byte{0x20, 0x01, 0x0d, 0xb8, 0xab, 0xcd, 0xef, 0x01},
+		},
+		{
+			name:      "zero prefix masks everything",
+			prefixLen: 0,
+			want:      [16]byte{},
+		},
+		{
+			name:      "full prefix keeps every bit",
+			prefixLen: 128,
+			want:      addr,
+		},
+		{
+			name:      "unaligned /60 clears the low nibble of byte 7",
+			prefixLen: 60,
+			want:      [16]byte{0x20, 0x01, 0x0d, 0xb8, 0xab, 0xcd, 0xef, 0x00},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := maskIPv6(addr, tc.prefixLen); got != tc.want {
+				t.Errorf("maskIPv6(%v, %d) = %v, want %v", addr, tc.prefixLen, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseIPv6(t *testing.T) {
+	addr, ok := parseIPv6([]byte("2001:db8::1"))
+	if !ok {
+		t.Fatal("parseIPv6 rejected a valid address")
+	}
+	wantPrefix := [8]byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00}
+	if got := [8]byte(addr[:8]); got != wantPrefix {
+		t.Errorf("parseIPv6 prefix = %v, want %v", got, wantPrefix)
+	}
+
+	if _, ok := parseIPv6([]byte("not-an-ip")); ok {
+		t.Error("parseIPv6 accepted an invalid address")
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+// mmapFileReader serves newline-aligned batches directly out of a read-only
+// mmap of the whole input file, so workers parse IPs without allocating a
+// string, or even copying a byte, per line.
+type mmapFileReader struct {
+	data   []byte
+	offset int
+}
+
+// newMmapFileReader maps f read-only for its entire size, positioned to
+// start handing out batches at startOffset (0 to start from the top).
+func newMmapFileReader(f *os.File, startOffset uint64) (*mmapFileReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mmapFileReader{data: data, offset: int(startOffset)}, nil
+}
+
+// nextBatch returns the next [start, end) slice of the mapped file, aligned
+// to the last newline within the window (when it holds one) so no line spans
+// two batches, along with end itself so the caller can checkpoint its progress.
+func (r *mmapFileReader) nextBatch() ([]byte, uint64, func(), bool, error) {
+	if r.offset >= len(r.data) {
+		return nil, 0, nil, false, nil
+	}
+
+	start := r.offset
+	end := start + mmapBatchBytes
+	if end >= len(r.data) {
+		end = len(r.data)
+	} else if cut := bytes.LastIndexByte(r.data[start:end], '\n'); cut >= 0 {
+		end = start + cut + 1
+	}
+	// If no newline is found in the window, the batch is handed back as-is
+	// so the reader still makes progress on an unusually long line.
+
+	r.offset = end
+	return r.data[start:end], uint64(end), func() {}, true, nil
+}
+
+// Close unmaps the file.
+func (r *mmapFileReader) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(r.data)
+	r.data = nil
+	return err
+}
@@ -1,24 +1,24 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	BatchSize       = 250000                              // Number of IPs processed in one batch. Optimized for memory and performance.
-	WorkerCount     = 8                                   // Number of goroutines (workers) for parallel processing.
-	MaxIP           = 1 << 32                             // Total possible IPv4 addresses (2^32).
-	ReadBufferSize  = 2 * 1024 * 1024                     // Buffer size for file reading in bytes (2 MB).
-	BitmapSegments  = 256                                 // Number of segments for bitmap parallelism.
-	BitsInByte      = 8                                   // Number of bits in one byte.
-	BytesPerSegment = MaxIP / BitmapSegments / BitsInByte // Bytes per segment in the segmented bitmap.
+	BatchSize          = 250000                              // Number of IPs processed in one batch. Optimized for memory and performance.
+	WorkerCount        = 8                                   // Number of goroutines (workers) for parallel processing.
+	MaxIP              = 1 << 32                             // Total possible IPv4 addresses (2^32).
+	ReadBufferSize     = 2 * 1024 * 1024                     // Buffer size for file reading in bytes (2 MB).
+	BitmapSegments     = 256                                 // Number of segments for bitmap parallelism.
+	BitsInByte         = 8                                   // Number of bits in one byte.
+	BytesPerSegment    = MaxIP / BitmapSegments / BitsInByte // Bytes per segment in the segmented bitmap.
+	CheckpointInterval = 100                                 // Batches between snapshot/WAL checkpoints when resume support is enabled.
 )
 
 // SegmentedBitmap tracks unique IPs using a segmented bitmap for thread-safe parallel processing.
@@ -58,6 +58,19 @@ func (sb *SegmentedBitmap) MarkIP(ipInt uint32) bool {
 	return true
 }
 
+// Count returns the bitmap's cardinality, i.e. the total number of bits set
+// across all segments. This gives a built-in progress/total without a
+// separate final scan of the input.
+func (sb *SegmentedBitmap) Count() uint64 {
+	var total uint64
+	for i := range sb.segments {
+		sb.mutexes[i].Lock()
+		total += countSetBits(sb.segments[i])
+		sb.mutexes[i].Unlock()
+	}
+	return total
+}
+
 // Cleanup releases the memory allocated for the bitmap segments to free resources.
 func (sb *SegmentedBitmap) Cleanup() {
 	for i := range sb.segments {
@@ -67,103 +80,197 @@ func (sb *SegmentedBitmap) Cleanup() {
 	}
 }
 
-// ipToInt converts an IP address string (e.g., "192.168.1.1") to a unique 32-bit integer representation.
-// Each segment of the IP is converted to an integer and shifted to its position.
-func ipToInt(ip string) uint32 {
+// ipToInt converts an IPv4 address (e.g., "192.168.1.1") to a unique 32-bit integer representation.
+// It takes ip as a byte slice so callers can parse directly out of a mapped file region without
+// allocating a string per line. Each octet is converted to an integer and shifted to its position.
+func ipToInt(ip []byte) uint32 {
 	var result uint32
-	segments := strings.Split(ip, ".") // Split IP into four segments.
-	for i, segment := range segments {
-		value := uint32(0)
-		for _, c := range segment {
-			value = value*10 + uint32(c-'0') // Convert string segment to integer.
+	octet, value := 0, uint32(0)
+	for _, c := range ip {
+		if c == '.' {
+			result |= value << (BitsInByte * uint(3-octet)) // Shift the completed octet into position.
+			octet++
+			value = 0
+			continue
 		}
-		result += value << (BitsInByte * uint(3-i)) // Shift each segment based on position.
+		value = value*10 + uint32(c-'0') // Convert digit to integer.
 	}
+	result |= value << (BitsInByte * uint(3-octet)) // Shift the final octet into position.
 	return result
 }
 
-// processBatch processes a batch of IPs, marking unique ones in the bitmap.
-// Returns the count of new unique IPs found in the batch.
-func processBatch(batch []string, sb *SegmentedBitmap) (int, error) {
-	uniqueCount := 0
-	for _, ip := range batch {
-		if ip == "" {
-			continue // Skip empty lines.
+// batchResult carries the per-batch unique counts for each address family.
+type batchResult struct {
+	uniqueV4 int // Newly marked IPv4 addresses in the batch.
+	uniqueV6 int // Newly marked IPv6 prefixes in the batch.
+}
+
+// batchCompletion reports a finished batchBuf back to the consumer loop.
+type batchCompletion struct {
+	seq       int
+	endOffset uint64
+	result    batchResult
+}
+
+// processBatch marks unique IPs from lines, pre-split by splitLines, in the appropriate
+// backend. Lines are routed to the IPv4 bitmap or the IPv6 prefix set based on the presence
+// of ':'. No per-line string is allocated: each line is a subslice of a mapped file region
+// or a reusable read buffer. Returns the count of new unique IPv4 and IPv6 entries found.
+// bloom may be nil, in which case every IPv4 line falls straight through to sb.MarkIP.
+func processBatch(lines [][]byte, sb *SegmentedBitmap, v6 *Ipv6PrefixSet, bloom *BloomPrefilter) (batchResult, error) {
+	var result batchResult
+	for _, line := range lines {
+		if bytes.IndexByte(line, ':') >= 0 {
+			addr, ok := parseIPv6(line)
+			if !ok {
+				continue // Skip malformed IPv6 lines.
+			}
+			if v6.MarkIP(addr) {
+				result.uniqueV6++
+			}
+			continue
+		}
+
+		ipInt := parseIPv4(line) // Convert IP to integer representation, via the fast path when available.
+		if bloom != nil && bloom.MaybeSeen(ipInt) {
+			continue // Probable duplicate: skip the segment mutex entirely.
 		}
-		ipInt := ipToInt(ip) // Convert IP to integer representation.
 		if sb.MarkIP(ipInt) {
-			uniqueCount++ // Increment count if IP was newly marked.
+			result.uniqueV4++ // Increment count if IP was newly marked.
+		}
+		if bloom != nil {
+			bloom.Add(ipInt) // Record it so future repeats can skip the mutex.
 		}
 	}
-	return uniqueCount, nil
+	return result, nil
 }
 
-// worker processes batches from a channel and sends results to a result channel.
-func worker(batchChan <-chan []string, sb *SegmentedBitmap, resultChan chan<- int, wg *sync.WaitGroup) {
+// worker pops batches from the ring queue and sends results to a result channel, returning
+// each batchBuf to pool once it has been fully processed.
+func worker(queue *ringQueue, pool *sync.Pool, sb *SegmentedBitmap, v6 *Ipv6PrefixSet, bloom *BloomPrefilter, resultChan chan<- batchCompletion, wg *sync.WaitGroup) {
 	defer wg.Done() // Notify WaitGroup when the worker is done.
 
-	for batch := range batchChan {
-		uniqueCount, err := processBatch(batch, sb)
+	for {
+		buf, ok := queue.Pop()
+		if !ok {
+			return // Queue closed and drained: no more batches will arrive.
+		}
+
+		result, err := processBatch(buf.lines, sb, v6, bloom)
+		buf.release() // Return the backing buffer (if any) now that the chunk has been consumed.
+		seq, endOffset := buf.seq, buf.endOffset
+		pool.Put(buf) // Return buf itself to the free list for reuse.
+
 		if err != nil {
 			log.Printf("Error processing batch: %v", err)
 			continue
 		}
-		resultChan <- uniqueCount // Send the count of unique IPs to the result channel.
+		resultChan <- batchCompletion{seq: seq, endOffset: endOffset, result: result}
 	}
 }
 
-// readBatch reads a batch of lines (IPs) from the file.
-func readBatch(reader *bufio.Reader) ([]string, error) {
-	batch := make([]string, 0, BatchSize)
-	for len(batch) < BatchSize {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF && len(batch) > 0 {
-				return batch, nil // Return the last batch if EOF is reached.
+// countUniqueIPs orchestrates the process of counting unique IPv4 and IPv6 addresses in a file.
+// IPv6 addresses are aggregated to ipv6PrefixLen bits before being counted, since a flat
+// 128-bit bitmap is infeasible. When bloomBits is non-zero, a BloomPrefilter of that size is
+// placed in front of the IPv4 bitmap to cut lock acquisitions on skewed, repeat-heavy workloads.
+// When checkpointDir is non-empty, both the IPv4 bitmap and the IPv6 prefix set are snapshotted
+// there every CheckpointInterval batches; passing resume=true loads the latest snapshots and
+// seeks the reader to the last WAL-recorded offset before continuing, rather than starting over.
+// Reprocessing input already covered by a stale snapshot is harmless: MarkIP only reports (and
+// counts) genuinely new bits/prefixes.
+// Returns the unique IPv4 count followed by the unique IPv6 count.
+func countUniqueIPs(filePath string, ipv6PrefixLen int, bloomBits uint64, checkpointDir string, resume bool) (int, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open file: %w", err) // Standardized error handling.
+	}
+	defer file.Close()
+
+	sb := NewSegmentedBitmap() // Initialize segmented bitmap for IPv4.
+	defer sb.Cleanup()         // Ensure memory is released.
+	v6, err := NewIpv6PrefixSet(ipv6PrefixLen)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer v6.Cleanup() // Ensure memory is released.
+
+	var bloom *BloomPrefilter // Left nil by default (and via --no-bloom): exact counting unless --bloom-bits opts in.
+	if bloomBits > 0 {
+		bloom = NewBloomPrefilter(bloomBits)
+	}
+
+	var wal *WriteAheadLog
+	var startOffset uint64
+	resumedV4, resumedV6 := 0, 0 // Entries already held by loaded snapshots.
+	if checkpointDir != "" {
+		if resume {
+			if err := sb.LoadSnapshot(checkpointDir); err != nil {
+				return 0, 0, fmt.Errorf("failed to load snapshot: %w", err)
+			}
+			if err := v6.LoadSnapshot(checkpointDir); err != nil {
+				return 0, 0, fmt.Errorf("failed to load ipv6 snapshot: %w", err)
+			}
+			resumedV4 = int(sb.Count())
+			for i := range v6.shards {
+				resumedV6 += len(v6.shards[i])
 			}
-			return nil, err // Return error if encountered.
+			if startOffset, err = LastWALOffset(checkpointDir); err != nil {
+				return 0, 0, fmt.Errorf("failed to read WAL: %w", err)
+			}
+		}
+		// flushInterval is 1, not CheckpointInterval: RecordBatchBoundary is already
+		// only called once every CheckpointInterval batches by the consumer loop below,
+		// so gating the fsync again here would mean it fires only once every
+		// CheckpointInterval^2 batches, leaving "checkpointed" WAL entries unsynced.
+		if wal, err = OpenWAL(checkpointDir, 1); err != nil {
+			return 0, 0, fmt.Errorf("failed to open WAL: %w", err)
 		}
-		batch = append(batch, strings.TrimSpace(line)) // Add trimmed line to the batch.
+		defer wal.Close()
 	}
-	return batch, nil
-}
 
-// countUniqueIPs orchestrates the process of counting unique IPs in a file.
-func countUniqueIPs(filePath string) (int, error) {
-	file, err := os.Open(filePath)
+	reader, err := openFileReader(file, startOffset) // mmap-backed for regular files, pread loop otherwise.
 	if err != nil {
-		return 0, fmt.Errorf("failed to open file: %w", err) // Standardized error handling.
+		return 0, 0, fmt.Errorf("failed to open file reader: %w", err)
 	}
-	defer file.Close()
-
-	reader := bufio.NewReaderSize(file, ReadBufferSize) // Efficient buffered file reading.
-	sb := NewSegmentedBitmap()                          // Initialize segmented bitmap.
-	defer sb.Cleanup()                                  // Ensure memory is released.
+	defer reader.Close()
 
-	batchChan := make(chan []string, WorkerCount) // Channel for passing batches to workers.
-	resultChan := make(chan int, WorkerCount)     // Channel for collecting results from workers.
+	queue := newRingQueue(RingCapacity)                   // Bounded free-flowing queue between reader and workers.
+	pool := newBatchBufPool()                             // Free list of *batchBuf, reused across the whole run.
+	resultChan := make(chan batchCompletion, WorkerCount) // Channel for collecting results from workers.
 
 	var wg sync.WaitGroup // Synchronizes worker goroutines.
 
 	// Start worker goroutines.
 	for i := 0; i < WorkerCount; i++ {
 		wg.Add(1)
-		go worker(batchChan, sb, resultChan, &wg)
+		go worker(queue, pool, sb, v6, bloom, resultChan, &wg)
 	}
 
-	// Goroutine to read the file and send batches to workers.
+	// Goroutine to read the file and push batches onto the ring queue. The reader can run up
+	// to RingCapacity batches ahead of the slowest worker instead of blocking after WorkerCount,
+	// and batches are handed out with strictly increasing offsets, which is what makes recovery
+	// deterministic.
 	go func() {
-		defer close(batchChan) // Close the batch channel after all batches are sent.
+		defer queue.Close() // Signal workers that no further batches will be pushed.
+		seq := 0
 		for {
-			batch, err := readBatch(reader)
-			if err == io.EOF {
-				break // End of file reached.
-			}
+			chunk, endOffset, release, ok, err := reader.nextBatch()
 			if err != nil {
 				log.Printf("Error reading batch: %v", err)
 				break
 			}
-			batchChan <- batch // Send batch to workers.
+			if !ok {
+				break // End of file reached.
+			}
+
+			buf := pool.Get().(*batchBuf)
+			buf.chunk = chunk
+			buf.release = release
+			buf.seq = seq
+			buf.endOffset = endOffset
+			buf.lines = splitLines(chunk, buf.lines[:0]) // Reuse buf's existing lines capacity.
+			queue.Push(buf)
+			seq++
 		}
 	}()
 
@@ -173,24 +280,69 @@ func countUniqueIPs(filePath string) (int, error) {
 		close(resultChan) // Close the result channel.
 	}()
 
-	totalUnique := 0
-	for uniqueCount := range resultChan {
-		totalUnique += uniqueCount // Accumulate unique counts from all batches.
+	totalUniqueV4, totalUniqueV6 := resumedV4, resumedV6 // Counts carry over from the snapshots on resume.
+	pending := make(map[int]batchCompletion) // Completions that arrived out of order, awaiting their turn.
+	nextSeq, completedSinceCheckpoint := 0, 0
+	for completion := range resultChan {
+		totalUniqueV4 += completion.result.uniqueV4 // Accumulate unique IPv4 counts from all batches.
+		totalUniqueV6 += completion.result.uniqueV6 // Accumulate unique IPv6 prefix counts from all batches.
+
+		if wal == nil {
+			continue
+		}
+		pending[completion.seq] = completion
+		for {
+			next, ok := pending[nextSeq]
+			if !ok {
+				break
+			}
+			delete(pending, nextSeq)
+			nextSeq++
+			completedSinceCheckpoint++
+			if completedSinceCheckpoint < CheckpointInterval {
+				continue
+			}
+			completedSinceCheckpoint = 0
+			if err := sb.SaveSnapshot(checkpointDir); err != nil {
+				log.Printf("Error saving checkpoint: %v", err)
+				continue
+			}
+			if err := v6.SaveSnapshot(checkpointDir); err != nil {
+				log.Printf("Error saving ipv6 checkpoint: %v", err)
+				continue // Don't advance the WAL past input the ipv6 snapshot didn't actually capture.
+			}
+			if err := wal.RecordBatchBoundary(next.endOffset); err != nil {
+				log.Printf("Error recording WAL entry: %v", err)
+			}
+		}
 	}
 
-	return totalUnique, nil
+	return totalUniqueV4, totalUniqueV6, nil
 }
 
 func main() {
-	start := time.Now()                                           // Start timing the execution.
-	filePath := "/Users/kirillmalovicko/go/src/test/ip_addresses" // Path to the file.
+	filePath := flag.String("file", "/Users/kirillmalovicko/go/src/test/ip_addresses", "Path to the file containing one IP address per line.")
+	ipv6PrefixLen := flag.Int("ipv6-prefix", DefaultIPv6Prefix, "CIDR prefix length used to aggregate IPv6 addresses before counting.")
+	bloomBits := flag.Uint64("bloom-bits", 0, "Size in bits of the IPv4 bloom prefilter. 0 (the default) disables it, so counting stays exact; the filter's ~1-4% false-positive rate can otherwise permanently undercount.")
+	noBloom := flag.Bool("no-bloom", false, "Disable the bloom prefilter even if --bloom-bits is set, for exact-worst-case benchmarking against SegmentedBitmap alone.")
+	checkpointDir := flag.String("checkpoint-dir", "", "Directory for periodic bitmap snapshots and the resume WAL. Empty disables checkpointing.")
+	resume := flag.Bool("resume", false, "Resume from the latest snapshot and WAL offset in --checkpoint-dir instead of starting over.")
+	flag.Parse()
+
+	start := time.Now() // Start timing the execution.
+
+	effectiveBloomBits := *bloomBits
+	if *noBloom {
+		effectiveBloomBits = 0
+	}
 
-	uniqueIPs, err := countUniqueIPs(filePath)
+	uniqueV4, uniqueV6, err := countUniqueIPs(*filePath, *ipv6PrefixLen, effectiveBloomBits, *checkpointDir, *resume)
 	if err != nil {
 		log.Fatalf("Error: %v", err) // Log and exit on error.
 	}
 
 	duration := time.Since(start) // Calculate execution time.
-	log.Printf("Unique IP addresses: %d", uniqueIPs)
+	log.Printf("Unique IPv4 addresses: %d", uniqueV4)
+	log.Printf("Unique IPv6 /%d prefixes: %d", *ipv6PrefixLen, uniqueV6)
 	log.Printf("Execution time: %v", duration)
 }
@@ -0,0 +1,25 @@
+package main
+
+import "math/bits"
+
+// countSetBits sums the set bits in a byte slice. It defaults to the
+// portable implementation and is upgraded to a POPCNT-based assembly
+// routine at init time on CPUs that support it (see popcount_amd64.go).
+var countSetBits = popcountBytesGeneric
+
+// popcountBytesGeneric is the pure-Go fallback used on CPUs without POPCNT.
+// It processes data in 8-byte chunks via math/bits.OnesCount64, then
+// handles any trailing partial chunk a byte at a time.
+func popcountBytesGeneric(data []byte) uint64 {
+	var total uint64
+	i := 0
+	for ; i+8 <= len(data); i += 8 {
+		chunk := uint64(data[i]) | uint64(data[i+1])<<8 | uint64(data[i+2])<<16 | uint64(data[i+3])<<24 |
+			uint64(data[i+4])<<32 | uint64(data[i+5])<<40 | uint64(data[i+6])<<48 | uint64(data[i+7])<<56
+		total += uint64(bits.OnesCount64(chunk))
+	}
+	for ; i < len(data); i++ {
+		total += uint64(bits.OnesCount8(data[i]))
+	}
+	return total
+}
@@ -0,0 +1,17 @@
+//go:build amd64
+
+package main
+
+import "katalvlaran/ip_counter/internal/cpu"
+
+// popcountBytes is implemented in popcount_amd64.s using the POPCNT
+// instruction. Only called after init confirms cpu.HasPOPCNT.
+//
+//go:noescape
+func popcountBytes(data []byte) uint64
+
+func init() {
+	if cpu.HasPOPCNT {
+		countSetBits = popcountBytes
+	}
+}
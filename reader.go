@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fileReader abstracts how batches of raw input bytes are produced. The
+// memory-mapped implementation (see mmap_unix.go / mmap_windows.go) hands
+// out zero-copy, newline-aligned slices straight out of the mapped file;
+// openFileReader falls back to pipeFileReader, a buffered pread loop, for
+// inputs that cannot be mapped, such as stdin or a pipe.
+type fileReader interface {
+	// nextBatch returns the next newline-aligned chunk of input, along with
+	// the absolute input-file offset immediately after it. release must be
+	// called once the caller is done with chunk, so a reusable buffer
+	// backing it (if any) can be handed back. ok is false once the input is
+	// exhausted. pipeFileReader always reports endOffset 0, since resuming
+	// from a non-seekable input (a true pipe or stdin) isn't supported.
+	nextBatch() (chunk []byte, endOffset uint64, release func(), ok bool, err error)
+	Close() error
+}
+
+// openFileReader picks the mmap-backed reader for regular, non-empty files
+// and falls back to pipeFileReader for anything else (pipes, stdin, sockets)
+// or if the mmap setup itself fails. startOffset resumes a previous run by
+// skipping straight to that point in the input; pass 0 to start from the top.
+func openFileReader(f *os.File, startOffset uint64) (fileReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().IsRegular() && info.Size() > 0 {
+		if r, err := newMmapFileReader(f, startOffset); err == nil {
+			return r, nil
+		}
+	}
+	return newPipeFileReader(f, startOffset)
+}
+
+// pipeBufferCount is the size of the reusable buffer ring used by the
+// pread-style fallback reader.
+const pipeBufferCount = 4
+
+// mmapBatchBytes is the approximate size of one (start, end) slice handed to
+// a worker by the mmap-backed readers; it is aligned down to the preceding
+// newline so a line is not split across two batches, unless the window holds
+// no newline at all, in which case it is handed out unaligned.
+const mmapBatchBytes = BatchSize * 16 // ~16 bytes per IPv4 line, a rough average.
+
+// pipeFileReader reads an input that cannot be mmap'd in large chunks using
+// a small ring of reusable buffers, avoiding a fresh allocation per read.
+// Each slot is only reused once the worker processing it has released it,
+// so a slow worker applies natural backpressure to the reader.
+type pipeFileReader struct {
+	file     *os.File
+	buffers  [pipeBufferCount][]byte
+	freeCh   [pipeBufferCount]chan struct{}
+	next     int
+	leftover []byte // Bytes read past the last newline, carried into the next chunk.
+}
+
+// newPipeFileReader allocates the buffer ring, marks every slot free, and
+// seeks to startOffset if one was requested (only possible for a seekable
+// file that still fell back to this reader, e.g. because mmap setup failed).
+func newPipeFileReader(f *os.File, startOffset uint64) (*pipeFileReader, error) {
+	if startOffset > 0 {
+		if _, err := f.Seek(int64(startOffset), io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to resume non-mmap input: %w", err)
+		}
+	}
+	r := &pipeFileReader{file: f}
+	for i := range r.buffers {
+		r.buffers[i] = make([]byte, ReadBufferSize)
+		r.freeCh[i] = make(chan struct{}, 1)
+		r.freeCh[i] <- struct{}{}
+	}
+	return r, nil
+}
+
+// nextBatch fills the next ring slot, waiting for its previous consumer to
+// release it, then returns everything up to the last newline in the slot.
+// Bytes past that newline are carried over as leftover for the next call.
+func (r *pipeFileReader) nextBatch() ([]byte, uint64, func(), bool, error) {
+	slot := r.next
+	<-r.freeCh[slot] // Wait until the previous consumer of this slot released it.
+	r.next = (r.next + 1) % pipeBufferCount
+
+	buf := r.buffers[slot]
+	n := copy(buf, r.leftover)
+	r.leftover = nil
+	for n < len(buf) {
+		read, err := r.file.Read(buf[n:])
+		n += read
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, 0, nil, false, err
+		}
+		if read == 0 {
+			break
+		}
+	}
+	release := func() { r.freeCh[slot] <- struct{}{} }
+
+	if n == 0 {
+		release()
+		return nil, 0, nil, false, nil
+	}
+
+	chunk := buf[:n]
+	cut := bytes.LastIndexByte(chunk, '\n')
+	if cut < 0 {
+		return chunk, 0, release, true, nil // No newline at all: treat it as a single line.
+	}
+	r.leftover = append([]byte(nil), chunk[cut+1:]...)
+	return chunk[:cut+1], 0, release, true, nil
+}
+
+// Close is a no-op: the underlying *os.File is owned and closed by the caller.
+func (r *pipeFileReader) Close() error { return nil }
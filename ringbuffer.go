@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// RingCapacity bounds how many batches the reader is allowed to fill ahead
+// of the slowest worker. It is independent of WorkerCount, unlike the old
+// batchChan whose capacity was tied to it, so the two can be tuned separately.
+const RingCapacity = 32
+
+// batchBuf pairs a newline-aligned chunk of input with its pre-split line
+// boundaries, computed once by the reader so workers never re-scan for '\n'.
+// Both the struct and its lines slice are recycled through a sync.Pool so
+// the hot path allocates nothing per batch beyond what parsing needs.
+type batchBuf struct {
+	chunk     []byte
+	release   func()
+	seq       int
+	endOffset uint64
+	lines     [][]byte
+}
+
+// splitLines appends chunk's non-empty, trimmed lines to lines (typically
+// passed in as an existing slice truncated to length 0), reusing its
+// backing array across batches instead of allocating a new one each time.
+func splitLines(chunk []byte, lines [][]byte) [][]byte {
+	pos := 0
+	for pos < len(chunk) {
+		var line []byte
+		if nl := bytes.IndexByte(chunk[pos:], '\n'); nl >= 0 {
+			line = chunk[pos : pos+nl]
+			pos += nl + 1
+		} else {
+			line = chunk[pos:]
+			pos = len(chunk)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ringQueue is a small bounded single-producer, multiple-consumer queue of
+// *batchBuf that decouples the reader from the worker pool: the reader can
+// keep filling buffers up to capacity while workers drain older ones,
+// without either side blocking on the other's pace beyond that bound.
+type ringQueue struct {
+	ch chan *batchBuf
+}
+
+// newRingQueue allocates a ring with room for capacity in-flight batches.
+func newRingQueue(capacity int) *ringQueue {
+	return &ringQueue{ch: make(chan *batchBuf, capacity)}
+}
+
+// Push hands a filled buffer to the queue, blocking only once capacity
+// in-flight batches are already queued.
+func (q *ringQueue) Push(buf *batchBuf) { q.ch <- buf }
+
+// Pop retrieves the next buffer to process. ok is false once Close has been
+// called and every previously pushed buffer has been drained.
+func (q *ringQueue) Pop() (*batchBuf, bool) {
+	buf, ok := <-q.ch
+	return buf, ok
+}
+
+// Close signals that no further buffers will be pushed.
+func (q *ringQueue) Close() { close(q.ch) }
+
+// newBatchBufPool returns a pool of empty *batchBuf, used as the reader's
+// free list: Get() recycles a previously released buffer (or allocates one
+// on first use), Put() returns it once a worker is done with it.
+func newBatchBufPool() *sync.Pool {
+	return &sync.Pool{New: func() any { return &batchBuf{} }}
+}
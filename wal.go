@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// walEntrySize is the size in bytes of one WAL record: a single uint64
+// input-file offset marking the end of the last checkpointed batch.
+const walEntrySize = 8
+
+// walFileName is the append-only log living alongside the segment snapshots
+// in the checkpoint directory.
+const walFileName = "wal.log"
+
+// WriteAheadLog records the input-file offset of the last checkpointed
+// batch boundary, flushed to disk every flushInterval records, so a resumed
+// run knows exactly where to seek the reader back to.
+type WriteAheadLog struct {
+	file          *os.File
+	sinceFlush    int
+	flushInterval int
+}
+
+// OpenWAL opens (creating if necessary) the WAL file inside dir.
+func OpenWAL(dir string, flushInterval int) (*WriteAheadLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+	return &WriteAheadLog{file: f, flushInterval: flushInterval}, nil
+}
+
+// RecordBatchBoundary appends offset, fsync-ing to disk every
+// flushInterval records so recovery never trusts a boundary the OS hasn't
+// durably written yet.
+func (w *WriteAheadLog) RecordBatchBoundary(offset uint64) error {
+	var buf [walEntrySize]byte
+	binary.LittleEndian.PutUint64(buf[:], offset)
+	if _, err := w.file.Write(buf[:]); err != nil {
+		return fmt.Errorf("failed to append WAL entry: %w", err)
+	}
+
+	w.sinceFlush++
+	if w.sinceFlush < w.flushInterval {
+		return nil
+	}
+	w.sinceFlush = 0
+	return w.file.Sync()
+}
+
+// LastWALOffset reads the WAL inside dir and returns the last recorded
+// batch boundary, or 0 if there is no WAL yet (nothing has been processed).
+func LastWALOffset(dir string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	data = data[:len(data)-len(data)%walEntrySize] // Drop a torn trailing record.
+	if len(data) < walEntrySize {
+		return 0, nil
+	}
+	last := data[len(data)-walEntrySize:]
+	return binary.LittleEndian.Uint64(last), nil
+}
+
+// Close closes the underlying WAL file.
+func (w *WriteAheadLog) Close() error {
+	return w.file.Close()
+}